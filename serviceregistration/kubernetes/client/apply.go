@@ -0,0 +1,114 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// ErrFieldConflict is returned when a Server-Side Apply patch conflicts
+// with fields already owned by another field manager. Retrying with
+// force=true resolves the conflict by taking ownership from the listed
+// managers.
+type ErrFieldConflict struct {
+	// Managers lists the field managers the apiserver says own the
+	// conflicting fields. It may be empty if the apiserver's response
+	// didn't name them in a recognizable form.
+	Managers []string
+
+	debuggingInfo string
+}
+
+func (e *ErrFieldConflict) Error() string {
+	return fmt.Sprintf("conflict with field managers %v: %s", e.Managers, e.debuggingInfo)
+}
+
+// conflictManagerPattern pulls the owning manager's name out of a
+// conflict cause's message, e.g. `conflict with "kubectl-client-side-apply"
+// using apiextensions.k8s.io/v1`.
+var conflictManagerPattern = regexp.MustCompile(`conflict with "([^"]+)"`)
+
+// ssaConflictStatus is the shape of the apiserver's 409 response body for a
+// Server-Side Apply conflict: a metav1.Status with one cause per
+// conflicting field, each cause naming the owning manager in its message.
+type ssaConflictStatus struct {
+	Details struct {
+		Causes []struct {
+			Message string `json:"message"`
+		} `json:"causes"`
+	} `json:"details"`
+}
+
+// parseFieldConflict builds an *ErrFieldConflict out of a 409 response.
+func parseFieldConflict(req *http.Request, reqBody []byte, resp *http.Response) error {
+	respBody, _ := ioutil.ReadAll(resp.Body)
+
+	var status ssaConflictStatus
+	var managers []string
+	if err := json.Unmarshal(respBody, &status); err == nil {
+		for _, cause := range status.Details.Causes {
+			if m := conflictManagerPattern.FindStringSubmatch(cause.Message); m != nil {
+				managers = append(managers, m[1])
+			}
+		}
+	}
+
+	return &ErrFieldConflict{
+		Managers:      managers,
+		debuggingInfo: fmt.Sprintf("req method: %s, req url: %s, req body: %s, resp statuscode: %d, resp respBody: %s", req.Method, req.URL, reqBody, resp.StatusCode, respBody),
+	}
+}
+
+// ServerSideApply applies obj to the pod identified by namespace and
+// podName using Server-Side Apply, under the given fieldManager. obj should
+// describe only the fields fieldManager owns; the apiserver merges it with
+// the existing object and tracks ownership in metadata.managedFields. This
+// is idempotent under concurrent mutators (kubectl, other controllers) the
+// way the plain JSON-patch PatchPod isn't, since it can't stomp fields
+// other managers own.
+//
+// If another manager already owns a field obj is trying to set, the
+// apiserver responds 409 Conflict and this returns an *ErrFieldConflict;
+// callers can retry with force=true to take ownership.
+func (c *Client) ServerSideApply(namespace, podName, fieldManager string, obj interface{}, force bool) error {
+	return c.ServerSideApplyContext(context.Background(), namespace, podName, fieldManager, obj, force)
+}
+
+// ServerSideApplyContext is ServerSideApply, but the request is also
+// abandoned if ctx is done.
+func (c *Client) ServerSideApplyContext(ctx context.Context, namespace, podName, fieldManager string, obj interface{}, force bool) error {
+	endpoint := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s", namespace, podName)
+
+	// Validate that we received required parameters.
+	if namespace == "" {
+		return ErrNamespaceUnset
+	}
+	if podName == "" {
+		return ErrPodNameUnset
+	}
+
+	body, err := sigsyaml.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	query.Set("fieldManager", fieldManager)
+	query.Set("force", strconv.FormatBool(force))
+
+	req, err := http.NewRequest(http.MethodPatch, c.config.Host+endpoint+"?"+query.Encode(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/apply-patch+yaml")
+
+	return c.do(ctx, req, nil)
+}
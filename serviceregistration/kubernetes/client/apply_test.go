@@ -0,0 +1,101 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseFieldConflict_ExtractsManagersFromCauses(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPatch, "https://apiserver/api/v1/namespaces/default/pods/my-pod", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := `{"details":{"causes":[
+		{"message":"conflict with \"kubectl-client-side-apply\" using v1"},
+		{"message":"conflict with \"other-controller\" using v1"}
+	]}}`
+	resp := &http.Response{
+		StatusCode: http.StatusConflict,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+
+	err = parseFieldConflict(req, nil, resp)
+	conflict, ok := err.(*ErrFieldConflict)
+	if !ok {
+		t.Fatalf("got error of type %T, want *ErrFieldConflict", err)
+	}
+	want := []string{"kubectl-client-side-apply", "other-controller"}
+	if len(conflict.Managers) != len(want) {
+		t.Fatalf("Managers = %v, want %v", conflict.Managers, want)
+	}
+	for i := range want {
+		if conflict.Managers[i] != want[i] {
+			t.Errorf("Managers[%d] = %q, want %q", i, conflict.Managers[i], want[i])
+		}
+	}
+}
+
+func TestParseFieldConflict_UnrecognizableBodyStillReturnsConflict(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPatch, "https://apiserver/api/v1/namespaces/default/pods/my-pod", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := &http.Response{
+		StatusCode: http.StatusConflict,
+		Body:       io.NopCloser(strings.NewReader("not json")),
+	}
+
+	err = parseFieldConflict(req, nil, resp)
+	conflict, ok := err.(*ErrFieldConflict)
+	if !ok {
+		t.Fatalf("got error of type %T, want *ErrFieldConflict", err)
+	}
+	if len(conflict.Managers) != 0 {
+		t.Errorf("Managers = %v, want empty for an unparseable body", conflict.Managers)
+	}
+}
+
+func TestServerSideApply_ConflictThenForceSucceeds(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fieldManager") != "my-manager" {
+			t.Errorf("fieldManager = %q, want %q", r.URL.Query().Get("fieldManager"), "my-manager")
+		}
+		if r.URL.Query().Get("force") == "true" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"details":{"causes":[{"message":"conflict with \"other-manager\" using v1"}]}}`))
+	}))
+	defer srv.Close()
+
+	c := testClient(t, srv.URL)
+
+	err := c.ServerSideApplyContext(context.Background(), "default", "my-pod", "my-manager", map[string]string{"key": "value"}, false)
+	conflict, ok := err.(*ErrFieldConflict)
+	if !ok {
+		t.Fatalf("got error of type %T, want *ErrFieldConflict", err)
+	}
+	if len(conflict.Managers) != 1 || conflict.Managers[0] != "other-manager" {
+		t.Fatalf("Managers = %v, want [other-manager]", conflict.Managers)
+	}
+
+	if err := c.ServerSideApplyContext(context.Background(), "default", "my-pod", "my-manager", map[string]string{"key": "value"}, true); err != nil {
+		t.Fatalf("force retry returned error: %v", err)
+	}
+}
+
+func TestServerSideApplyContext_RequiresNamespaceAndPodName(t *testing.T) {
+	c := testClient(t, "https://apiserver")
+
+	if err := c.ServerSideApplyContext(context.Background(), "", "my-pod", "mgr", nil, false); err != ErrNamespaceUnset {
+		t.Errorf("got %v, want ErrNamespaceUnset", err)
+	}
+	if err := c.ServerSideApplyContext(context.Background(), "default", "", "mgr", nil, false); err != ErrPodNameUnset {
+		t.Errorf("got %v, want ErrPodNameUnset", err)
+	}
+}
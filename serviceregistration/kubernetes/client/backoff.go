@@ -0,0 +1,86 @@
+package client
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff"
+)
+
+// MetricsRecorder lets callers observe the client's retry behavior, e.g. to
+// export it as Prometheus metrics, without this package taking a dependency
+// on any particular metrics library.
+type MetricsRecorder interface {
+	// RecordRetry is called once per retry, after the attempt that
+	// triggered it has failed against the given host+path key.
+	RecordRetry(key string, statusCode int)
+
+	// RecordBackoff is called with how long the client is about to sleep
+	// before its next attempt against the given host+path key.
+	RecordBackoff(key string, d time.Duration)
+}
+
+// urlBackoffManager hands out a *backoff.ExponentialBackOff per host+path,
+// so a pod endpoint returning 503 only slows down callers hitting that same
+// pod, the way client-go's URLBackoff isolates backoff state per endpoint
+// instead of applying it globally.
+type urlBackoffManager struct {
+	newBackoff func() *backoff.ExponentialBackOff
+
+	mu      sync.Mutex
+	entries map[string]*backoff.ExponentialBackOff
+}
+
+func newURLBackoffManager(newBackoff func() *backoff.ExponentialBackOff) *urlBackoffManager {
+	return &urlBackoffManager{
+		newBackoff: newBackoff,
+		entries:    make(map[string]*backoff.ExponentialBackOff),
+	}
+}
+
+// next returns how long to wait before the next attempt against req's
+// host+path, advancing that endpoint's backoff state.
+func (m *urlBackoffManager) next(req *http.Request) time.Duration {
+	key := backoffKey(req)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.entries[key]
+	if !ok {
+		b = m.newBackoff()
+		m.entries[key] = b
+	}
+	return b.NextBackOff()
+}
+
+// reset drops req's host+path backoff state, so the next failure against it
+// starts from the initial interval again.
+func (m *urlBackoffManager) reset(req *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, backoffKey(req))
+}
+
+func backoffKey(req *http.Request) string {
+	return req.URL.Host + req.URL.Path
+}
+
+// newExponentialBackOff builds a backoff.ExponentialBackOff from this
+// client's Config, falling back to the backoff library's own defaults for
+// whatever the operator hasn't set.
+func (c *Client) newExponentialBackOff() *backoff.ExponentialBackOff {
+	b := backoff.NewExponentialBackOff()
+	if c.config.BackoffInitialInterval > 0 {
+		b.InitialInterval = c.config.BackoffInitialInterval
+	}
+	if c.config.BackoffMaxInterval > 0 {
+		b.MaxInterval = c.config.BackoffMaxInterval
+	}
+	if c.config.BackoffMaxElapsedTime > 0 {
+		b.MaxElapsedTime = c.config.BackoffMaxElapsedTime
+	}
+	if c.config.BackoffMultiplier > 0 {
+		b.Multiplier = c.config.BackoffMultiplier
+	}
+	return b
+}
@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/hashicorp/go-hclog"
+)
+
+// newTestBackoff returns a deterministic (no jitter) exponential backoff so
+// tests can assert on exact durations.
+func newTestBackoff() *backoff.ExponentialBackOff {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = 10 * time.Millisecond
+	b.MaxInterval = time.Second
+	b.Multiplier = 2
+	b.RandomizationFactor = 0
+	b.MaxElapsedTime = 0
+	b.Reset()
+	return b
+}
+
+func TestURLBackoffManager_IsolatesPerHostPath(t *testing.T) {
+	m := newURLBackoffManager(newTestBackoff)
+	reqA, _ := http.NewRequest(http.MethodGet, "http://host-a/path", nil)
+	reqB, _ := http.NewRequest(http.MethodGet, "http://host-b/path", nil)
+
+	if d := m.next(reqA); d != 10*time.Millisecond {
+		t.Fatalf("first backoff for host-a = %v, want 10ms", d)
+	}
+	// Advance host-a's state a second time.
+	m.next(reqA)
+
+	if d := m.next(reqB); d != 10*time.Millisecond {
+		t.Fatalf("first backoff for host-b = %v, want 10ms -- host-a's advancement must not leak across endpoints", d)
+	}
+}
+
+func TestURLBackoffManager_ResetRestartsFromInitialInterval(t *testing.T) {
+	m := newURLBackoffManager(newTestBackoff)
+	req, _ := http.NewRequest(http.MethodGet, "http://host/path", nil)
+
+	m.next(req)
+	if d := m.next(req); d != 20*time.Millisecond {
+		t.Fatalf("second backoff = %v, want 20ms", d)
+	}
+
+	m.reset(req)
+	if d := m.next(req); d != 10*time.Millisecond {
+		t.Fatalf("backoff after reset = %v, want 10ms", d)
+	}
+}
+
+func TestURLBackoffManager_StopsAfterMaxElapsedTime(t *testing.T) {
+	newBackoff := func() *backoff.ExponentialBackOff {
+		b := backoff.NewExponentialBackOff()
+		b.InitialInterval = time.Millisecond
+		b.MaxInterval = time.Millisecond
+		b.Multiplier = 2
+		b.RandomizationFactor = 0
+		b.MaxElapsedTime = 5 * time.Millisecond
+		b.Reset()
+		return b
+	}
+	m := newURLBackoffManager(newBackoff)
+	req, _ := http.NewRequest(http.MethodGet, "http://host/path", nil)
+
+	// The endpoint's backoff, and its elapsed-time clock, starts on the
+	// first next() call.
+	m.next(req)
+	time.Sleep(10 * time.Millisecond)
+	if d := m.next(req); d != backoff.Stop {
+		t.Fatalf("next() = %v, want backoff.Stop once MaxElapsedTime has elapsed", d)
+	}
+}
+
+func TestBackoffKey_CombinesHostAndPath(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "http://host.example.com:8080/api/v1/pods", nil)
+	if got, want := backoffKey(req), "host.example.com:8080/api/v1/pods"; got != want {
+		t.Fatalf("backoffKey = %q, want %q", got, want)
+	}
+}
+
+type recordingMetrics struct {
+	mu       sync.Mutex
+	retries  []string
+	backoffs []string
+}
+
+func (r *recordingMetrics) RecordRetry(key string, statusCode int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.retries = append(r.retries, fmt.Sprintf("%s:%d", key, statusCode))
+}
+
+func (r *recordingMetrics) RecordBackoff(key string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.backoffs = append(r.backoffs, key)
+}
+
+func TestClient_RecordsRetryAndBackoffMetrics(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	metrics := &recordingMetrics{}
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	config := &Config{
+		Host:                   srv.URL,
+		Metrics:                metrics,
+		BackoffInitialInterval: time.Millisecond,
+		BackoffMaxInterval:     time.Millisecond,
+	}
+	c := newClient(hclog.NewNullLogger(), config, stopCh)
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/namespaces/default/pods/my-pod", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.do(context.Background(), req, nil); err != nil {
+		t.Fatalf("do returned error: %v", err)
+	}
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	if len(metrics.retries) != 2 {
+		t.Fatalf("got %d RecordRetry calls, want 2: %v", len(metrics.retries), metrics.retries)
+	}
+	if len(metrics.backoffs) != 2 {
+		t.Fatalf("got %d RecordBackoff calls, want 2: %v", len(metrics.backoffs), metrics.backoffs)
+	}
+}
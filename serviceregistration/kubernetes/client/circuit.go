@@ -0,0 +1,186 @@
+package client
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCircuitBreakerFailureThreshold = 5
+	defaultCircuitBreakerWindow           = 30 * time.Second
+	defaultCircuitBreakerCooldown         = 30 * time.Second
+)
+
+// CircuitObserver is notified whenever a host's circuit breaker changes
+// state, e.g. to export it as a metric or log line externally.
+type CircuitObserver interface {
+	OnStateChange(host string, from, to string)
+}
+
+// ErrCircuitOpen is returned instead of attempting a request against a host
+// whose circuit breaker has tripped open.
+type ErrCircuitOpen struct {
+	Host string
+}
+
+func (e *ErrCircuitOpen) Error() string {
+	return fmt.Sprintf("circuit breaker open for %s", e.Host)
+}
+
+// circuitState is one of the three states a circuitBreaker moves through.
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker trips open after enough consecutive 5xx/connection errors
+// against a single apiserver host pile up within its window, so that a
+// struggling apiserver being mutated by thousands of in-flight requests
+// (e.g. the injector touching every pod in a large cluster) doesn't get a
+// synchronized retry stampede on top of whatever's already wrong with it.
+type circuitBreaker struct {
+	host     string
+	failures int
+	window   time.Duration
+	cooldown time.Duration
+	observer CircuitObserver
+
+	mu               sync.Mutex
+	state            circuitState
+	recentFailures   []time.Time
+	openedAt         time.Time
+	halfOpenInFlight bool
+}
+
+func newCircuitBreaker(host string, failures int, window, cooldown time.Duration, observer CircuitObserver) *circuitBreaker {
+	return &circuitBreaker{
+		host:     host,
+		failures: failures,
+		window:   window,
+		cooldown: cooldown,
+		observer: observer,
+	}
+}
+
+// allow reports whether a request against this breaker's host may proceed,
+// and if so, whether it's the single probe a half-open breaker permits.
+func (b *circuitBreaker) allow() (ok bool, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false, false
+		}
+		b.setState(circuitHalfOpen)
+		b.halfOpenInFlight = true
+		return true, true
+	case circuitHalfOpen:
+		if b.halfOpenInFlight {
+			return false, false
+		}
+		b.halfOpenInFlight = true
+		return true, true
+	default:
+		return true, false
+	}
+}
+
+// recordSuccess closes the breaker: a successful probe confirms the host
+// has recovered, and a successful closed-state request resets the failure
+// window.
+func (b *circuitBreaker) recordSuccess(probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.recentFailures = nil
+	if probe {
+		b.halfOpenInFlight = false
+	}
+	b.setState(circuitClosed)
+}
+
+// recordFailure counts a 5xx or connection error toward the breaker's
+// window, tripping it open once enough accumulate. A failed probe sends a
+// half-open breaker straight back to open for another cooldown.
+func (b *circuitBreaker) recordFailure(probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.halfOpenInFlight = false
+		b.openedAt = time.Now()
+		b.setState(circuitOpen)
+		return
+	}
+
+	now := time.Now()
+	b.recentFailures = append(b.recentFailures, now)
+	cutoff := now.Add(-b.window)
+	live := b.recentFailures[:0]
+	for _, t := range b.recentFailures {
+		if t.After(cutoff) {
+			live = append(live, t)
+		}
+	}
+	b.recentFailures = live
+
+	if b.state == circuitClosed && len(b.recentFailures) >= b.failures {
+		b.openedAt = now
+		b.setState(circuitOpen)
+	}
+}
+
+// setState must be called with b.mu held.
+func (b *circuitBreaker) setState(s circuitState) {
+	if s == b.state {
+		return
+	}
+	from := b.state
+	b.state = s
+	if b.observer != nil {
+		b.observer.OnStateChange(b.host, from.String(), s.String())
+	}
+}
+
+// circuitBreakerManager hands out a *circuitBreaker per apiserver host, so
+// an outage against one host doesn't trip requests to another.
+type circuitBreakerManager struct {
+	newBreaker func(host string) *circuitBreaker
+
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func newCircuitBreakerManager(newBreaker func(host string) *circuitBreaker) *circuitBreakerManager {
+	return &circuitBreakerManager{
+		newBreaker: newBreaker,
+		breakers:   make(map[string]*circuitBreaker),
+	}
+}
+
+func (m *circuitBreakerManager) forHost(host string) *circuitBreaker {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.breakers[host]
+	if !ok {
+		b = m.newBreaker(host)
+		m.breakers[host] = b
+	}
+	return b
+}
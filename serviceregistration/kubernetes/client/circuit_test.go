@@ -0,0 +1,174 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker_ClosedAllowsRequests(t *testing.T) {
+	b := newCircuitBreaker("host", 3, time.Minute, time.Minute, nil)
+
+	allowed, probe := b.allow()
+	if !allowed || probe {
+		t.Fatalf("allow() = (%v, %v), want (true, false)", allowed, probe)
+	}
+}
+
+func TestCircuitBreaker_OpensAfterThresholdFailures(t *testing.T) {
+	b := newCircuitBreaker("host", 3, time.Minute, time.Minute, nil)
+
+	for i := 0; i < 2; i++ {
+		b.recordFailure(false)
+		if b.state != circuitClosed {
+			t.Fatalf("after %d failures state = %s, want closed", i+1, b.state)
+		}
+	}
+
+	b.recordFailure(false)
+	if b.state != circuitOpen {
+		t.Fatalf("after threshold failures state = %s, want open", b.state)
+	}
+
+	allowed, _ := b.allow()
+	if allowed {
+		t.Fatal("allow() = true while open and still within cooldown")
+	}
+}
+
+func TestCircuitBreaker_FailuresOutsideWindowDontCount(t *testing.T) {
+	b := newCircuitBreaker("host", 3, time.Millisecond, time.Minute, nil)
+
+	b.recordFailure(false)
+	time.Sleep(5 * time.Millisecond)
+	b.recordFailure(false)
+	b.recordFailure(false)
+
+	if b.state != circuitClosed {
+		t.Fatalf("state = %s, want closed since the first failure aged out of the window", b.state)
+	}
+}
+
+func TestCircuitBreaker_HalfOpenAfterCooldown(t *testing.T) {
+	b := newCircuitBreaker("host", 1, time.Minute, time.Millisecond, nil)
+
+	b.recordFailure(false)
+	if b.state != circuitOpen {
+		t.Fatalf("state = %s, want open", b.state)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	allowed, probe := b.allow()
+	if !allowed || !probe {
+		t.Fatalf("allow() = (%v, %v), want (true, true) for the half-open probe", allowed, probe)
+	}
+	if b.state != circuitHalfOpen {
+		t.Fatalf("state = %s, want half-open", b.state)
+	}
+
+	// A second caller arriving while the probe is in flight isn't allowed to
+	// pile on.
+	allowed, probe = b.allow()
+	if allowed {
+		t.Fatal("allow() = true for a second request while a half-open probe is already in flight")
+	}
+}
+
+func TestCircuitBreaker_SuccessfulProbeCloses(t *testing.T) {
+	b := newCircuitBreaker("host", 1, time.Minute, time.Millisecond, nil)
+
+	b.recordFailure(false)
+	time.Sleep(5 * time.Millisecond)
+	_, probe := b.allow()
+	if !probe {
+		t.Fatal("expected a half-open probe to be granted")
+	}
+
+	b.recordSuccess(probe)
+	if b.state != circuitClosed {
+		t.Fatalf("state = %s, want closed after a successful probe", b.state)
+	}
+
+	allowed, probe := b.allow()
+	if !allowed || probe {
+		t.Fatalf("allow() = (%v, %v), want (true, false) once closed again", allowed, probe)
+	}
+}
+
+func TestCircuitBreaker_FailedProbeReopens(t *testing.T) {
+	b := newCircuitBreaker("host", 1, time.Minute, time.Millisecond, nil)
+
+	b.recordFailure(false)
+	time.Sleep(5 * time.Millisecond)
+	_, probe := b.allow()
+	if !probe {
+		t.Fatal("expected a half-open probe to be granted")
+	}
+
+	b.recordFailure(probe)
+	if b.state != circuitOpen {
+		t.Fatalf("state = %s, want open again after the probe failed", b.state)
+	}
+
+	allowed, _ := b.allow()
+	if allowed {
+		t.Fatal("allow() = true immediately after a failed probe reopened the breaker")
+	}
+}
+
+func TestCircuitBreakerManager_IsolatesPerHost(t *testing.T) {
+	m := newCircuitBreakerManager(func(host string) *circuitBreaker {
+		return newCircuitBreaker(host, 1, time.Minute, time.Minute, nil)
+	})
+
+	a := m.forHost("a.example.com")
+	a.recordFailure(false)
+	if a.state != circuitOpen {
+		t.Fatalf("host a state = %s, want open", a.state)
+	}
+
+	b := m.forHost("b.example.com")
+	if b.state != circuitClosed {
+		t.Fatalf("host b state = %s, want closed -- failures on host a must not affect it", b.state)
+	}
+
+	if m.forHost("a.example.com") != a {
+		t.Fatal("forHost returned a different breaker for the same host on a second call")
+	}
+}
+
+type stateChange struct {
+	host, from, to string
+}
+
+type recordingObserver struct {
+	changes []stateChange
+}
+
+func (r *recordingObserver) OnStateChange(host, from, to string) {
+	r.changes = append(r.changes, stateChange{host, from, to})
+}
+
+func TestCircuitBreaker_NotifiesObserverOnStateChange(t *testing.T) {
+	observer := &recordingObserver{}
+	b := newCircuitBreaker("host", 1, time.Minute, time.Millisecond, observer)
+
+	b.recordFailure(false)
+	time.Sleep(5 * time.Millisecond)
+	_, probe := b.allow()
+	b.recordSuccess(probe)
+
+	want := []stateChange{
+		{"host", "closed", "open"},
+		{"host", "open", "half-open"},
+		{"host", "half-open", "closed"},
+	}
+	if len(observer.changes) != len(want) {
+		t.Fatalf("got %d state changes, want %d: %+v", len(observer.changes), len(want), observer.changes)
+	}
+	for i, c := range want {
+		if observer.changes[i] != c {
+			t.Errorf("change %d = %+v, want %+v", i, observer.changes[i], c)
+		}
+	}
+}
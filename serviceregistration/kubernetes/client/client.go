@@ -2,12 +2,19 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff"
@@ -15,13 +22,10 @@ import (
 	"github.com/hashicorp/go-hclog"
 )
 
-// maxRetries is the maximum number of times the client
-// should retry.
-const maxRetries = 10
-
 var (
 	ErrNamespaceUnset = errors.New(`"namespace" is unset`)
 	ErrPodNameUnset   = errors.New(`"podName" is unset`)
+	ErrNameUnset      = errors.New(`"name" is unset`)
 	ErrNotInCluster   = errors.New("unable to load in-cluster configuration, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT must be defined")
 )
 
@@ -32,26 +36,101 @@ func New(logger hclog.Logger, stopCh <-chan struct{}) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Client{
+	return newClient(logger, config, stopCh), nil
+}
+
+// NewFromKubeconfig instantiates a Client from a kubeconfig file on disk,
+// using the named context or, if context is empty, the kubeconfig's
+// "current-context". This lets the injector and agent be pointed at a
+// remote cluster for local testing, the way dex and helm discover cluster
+// credentials outside of a pod.
+func NewFromKubeconfig(path string, context string, logger hclog.Logger, stopCh <-chan struct{}) (*Client, error) {
+	config, err := configFromKubeconfig(path, context)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(logger, config, stopCh), nil
+}
+
+// NewAuto instantiates a Client using in-cluster configuration if it's
+// available, falling back to a kubeconfig file found at $KUBECONFIG or
+// ~/.kube/config otherwise, the same order kubectl itself checks.
+func NewAuto(logger hclog.Logger, stopCh <-chan struct{}) (*Client, error) {
+	config, err := inClusterConfig()
+	if err == nil {
+		return newClient(logger, config, stopCh), nil
+	}
+	if !errors.Is(err, ErrNotInCluster) {
+		return nil, err
+	}
+
+	path := os.Getenv("KUBECONFIG")
+	if path == "" {
+		home, homeErr := os.UserHomeDir()
+		if homeErr != nil {
+			return nil, homeErr
+		}
+		path = filepath.Join(home, ".kube", "config")
+	}
+	return NewFromKubeconfig(path, "", logger, stopCh)
+}
+
+// newClient builds a Client around an already-resolved config, wiring up
+// the per-endpoint backoff state every constructor needs.
+func newClient(logger hclog.Logger, config *Config, stopCh <-chan struct{}) *Client {
+	c := &Client{
 		logger: logger,
 		config: config,
 		stopCh: stopCh,
-	}, nil
+	}
+	c.backoffs = newURLBackoffManager(c.newExponentialBackOff)
+	c.circuits = newCircuitBreakerManager(func(host string) *circuitBreaker {
+		threshold := config.CircuitBreakerFailureThreshold
+		if threshold <= 0 {
+			threshold = defaultCircuitBreakerFailureThreshold
+		}
+		window := config.CircuitBreakerWindow
+		if window <= 0 {
+			window = defaultCircuitBreakerWindow
+		}
+		cooldown := config.CircuitBreakerCooldown
+		if cooldown <= 0 {
+			cooldown = defaultCircuitBreakerCooldown
+		}
+		return newCircuitBreaker(host, threshold, window, cooldown, config.CircuitObserver)
+	})
+	return c
 }
 
-// Client is a minimal Kubernetes client. We rolled our own because the existing
-// Kubernetes client-go library available externally has a high number of dependencies
-// and we thought it wasn't worth it for only two API calls. If at some point they break
-// the client into smaller modules, or if we add quite a few methods to this client, it may
-// be worthwhile to revisit that decision.
+// Client is a hand-rolled Kubernetes client covering pods, generic
+// resources (Get/List/Watch/Patch/ServerSideApply), and log streaming. We
+// rolled our own rather than taking a dependency on client-go because it
+// pulls in a large dependency graph; this client only needs to speak plain
+// REST and NDJSON watch streams against the apiserver. Per-endpoint retry
+// backoff and a per-host circuit breaker guard every request path against
+// a struggling or overloaded apiserver.
 type Client struct {
 	logger hclog.Logger
 	config *Config
 	stopCh <-chan struct{}
+
+	// backoffs tracks retry backoff state per apiserver endpoint, so a
+	// failing endpoint doesn't impose delays on unrelated ones.
+	backoffs *urlBackoffManager
+
+	// circuits tracks circuit breaker state per apiserver host, so a
+	// struggling apiserver doesn't get hit with a retry stampede.
+	circuits *circuitBreakerManager
 }
 
 // GetPod gets a pod from the Kubernetes API.
 func (c *Client) GetPod(namespace, podName string) (*Pod, error) {
+	return c.GetPodContext(context.Background(), namespace, podName)
+}
+
+// GetPodContext is GetPod, but the request is also abandoned if ctx is
+// done, in addition to the client's stopCh closing.
+func (c *Client) GetPodContext(ctx context.Context, namespace, podName string) (*Pod, error) {
 	endpoint := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s", namespace, podName)
 	method := http.MethodGet
 
@@ -68,7 +147,7 @@ func (c *Client) GetPod(namespace, podName string) (*Pod, error) {
 		return nil, err
 	}
 	pod := &Pod{}
-	if err := c.do(req, pod); err != nil {
+	if err := c.do(ctx, req, pod); err != nil {
 		return nil, err
 	}
 	return pod, nil
@@ -78,6 +157,12 @@ func (c *Client) GetPod(namespace, podName string) (*Pod, error) {
 // It does so non-destructively, or in other words, without tearing down
 // the pod.
 func (c *Client) PatchPod(namespace, podName string, patches ...*Patch) error {
+	return c.PatchPodContext(context.Background(), namespace, podName, patches...)
+}
+
+// PatchPodContext is PatchPod, but the request is also abandoned if ctx is
+// done, in addition to the client's stopCh closing.
+func (c *Client) PatchPodContext(ctx context.Context, namespace, podName string, patches ...*Patch) error {
 	endpoint := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s", namespace, podName)
 	method := http.MethodPatch
 
@@ -112,50 +197,216 @@ func (c *Client) PatchPod(namespace, podName string, patches ...*Patch) error {
 	if err != nil {
 		return err
 	}
-	req.Header.Set("Content-Type", "application/json-patch+json")
-	return c.do(req, nil)
+	req.Header.Set("Content-Type", string(JSONPatch))
+	return c.do(ctx, req, nil)
 }
 
-// do executes the given request, retrying if necessary.
-func (c *Client) do(req *http.Request, ptrToReturnObj interface{}) error {
-	// Finish setting up a valid request.
+// LogParams controls which portion of a container's logs StreamLogs returns.
+// It mirrors the query parameters accepted by the Kubernetes pod log
+// subresource.
+type LogParams struct {
+	// Container selects which container's logs to stream. Required if the
+	// pod has more than one container.
+	Container string
+
+	// Follow keeps the connection open and streams new log lines as they're
+	// written, the way "kubectl logs -f" does.
+	Follow bool
+
+	// SinceSeconds, if set, returns only logs newer than this many seconds.
+	SinceSeconds *int64
+
+	// TailLines, if set, returns only this many of the most recent log lines.
+	TailLines *int64
+}
+
+// StreamLogs streams a container's logs from the Kubernetes API. The
+// returned ReadCloser is the live response body -- it's safe to wrap in a
+// bufio.Scanner to read it line by line -- and the caller must close it when
+// done. The stream is also closed automatically if the client's stopCh is
+// closed, so callers don't need to plumb that through separately.
+func (c *Client) StreamLogs(namespace, podName string, params LogParams) (io.ReadCloser, error) {
+	endpoint := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/log", namespace, podName)
+
+	// Validate that we received required parameters.
+	if namespace == "" {
+		return nil, ErrNamespaceUnset
+	}
+	if podName == "" {
+		return nil, ErrPodNameUnset
+	}
+
+	query := url.Values{}
+	if params.Container != "" {
+		query.Set("container", params.Container)
+	}
+	if params.Follow {
+		query.Set("follow", "true")
+	}
+	if params.SinceSeconds != nil {
+		query.Set("sinceSeconds", strconv.FormatInt(*params.SinceSeconds, 10))
+	}
+	if params.TailLines != nil {
+		query.Set("tailLines", strconv.FormatInt(*params.TailLines, 10))
+	}
+
+	req, err := http.NewRequest(http.MethodGet, c.config.Host+endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	client, err := c.prepareRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Execute and retry the request through the same retryLoop do and
+	// openWatchStream use, but hand the live body back to the caller on
+	// success instead of decoding it.
+	var body io.ReadCloser
+	if err := c.retryLoop(context.Background(), req, func() (bool, int, error) {
+		shouldRetry, statusCode, b, err := c.attemptStreamRequest(client, req)
+		body = b
+		return shouldRetry, statusCode, err
+	}); err != nil {
+		return nil, err
+	}
+	if body == nil {
+		// The client's stopCh closed while we were waiting to retry.
+		return nil, nil
+	}
+	return newLogStream(body, c.stopCh), nil
+}
+
+// prepareRequest finishes filling out req with this client's auth headers
+// and returns an *http.Client configured with its TLS trust root and, if
+// configured, client certificate. Both the buffering do path and the
+// streaming StreamLogs path share it so the two can't drift apart.
+func (c *Client) prepareRequest(req *http.Request) (*http.Client, error) {
 	req.Header.Set("Authorization", "Bearer "+c.config.BearerToken)
 	req.Header.Set("Accept", "application/json")
+	if c.config.ImpersonateUser != "" {
+		req.Header.Set("Impersonate-User", c.config.ImpersonateUser)
+	}
+	for _, group := range c.config.ImpersonateGroups {
+		req.Header.Add("Impersonate-Group", group)
+	}
+
+	tlsConfig := &tls.Config{
+		RootCAs: c.config.CACertPool,
+	}
+	if len(c.config.ClientCert) > 0 && len(c.config.ClientKey) > 0 {
+		cert, err := tls.X509KeyPair(c.config.ClientCert, c.config.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
 	client := cleanhttp.DefaultClient()
 	client.Transport = &http.Transport{
-		TLSClientConfig: &tls.Config{
-			RootCAs: c.config.CACertPool,
-		},
+		TLSClientConfig: tlsConfig,
+	}
+	return client, nil
+}
+
+// do executes the given request, retrying if necessary. It honors both ctx
+// being done and the client's stopCh closing.
+func (c *Client) do(ctx context.Context, req *http.Request, ptrToReturnObj interface{}) error {
+	req = req.WithContext(ctx)
+
+	// Finish setting up a valid request.
+	client, err := c.prepareRequest(req)
+	if err != nil {
+		return err
 	}
 
-	// Execute and retry the request. This exponential backoff comes
-	// with jitter already rolled in.
+	return c.retryLoop(ctx, req, func() (bool, int, error) {
+		return c.attemptRequest(client, req, ptrToReturnObj)
+	})
+}
+
+// retryLoop drives a single logical request through as many attempts as it
+// takes to either succeed or give up, sleeping on this request's endpoint
+// backoff between them and reporting retries and backoff delays to
+// c.config.Metrics. There's no fixed attempt cap: the backoff itself is the
+// retry budget, bounded by its configured MaxElapsedTime (backoff.Stop) and
+// by ctx/stopCh, so an operator who configures a generous
+// BackoffMaxElapsedTime actually gets that much retry persistence. attempt
+// performs one try and reports whether the loop should retry, the status
+// code it observed (for RecordRetry), and the error to propagate. do,
+// StreamLogs, and Watch's openWatchStream all share this instead of each
+// maintaining their own copy of the bookkeeping, so a fix to one applies to
+// all three.
+func (c *Client) retryLoop(ctx context.Context, req *http.Request, attempt func() (shouldRetry bool, statusCode int, err error)) error {
 	var lastErr error
-	b := backoff.NewExponentialBackOff()
-	for i := 0; i < maxRetries; i++ {
+	for i := 0; ; i++ {
 		if i != 0 {
+			d := c.backoffs.next(req)
+			if d == backoff.Stop {
+				// The endpoint's backoff has exceeded its configured
+				// MaxElapsedTime. Give up instead of looping with a
+				// negative delay, which NewTimer would otherwise fire
+				// immediately and turn into a zero-wait retry storm.
+				return fmt.Errorf("giving up on %s after exceeding the configured backoff max elapsed time: %w", backoffKey(req), lastErr)
+			}
+			if c.config.Metrics != nil {
+				c.config.Metrics.RecordBackoff(backoffKey(req), d)
+			}
 			select {
+			case <-ctx.Done():
+				return ctx.Err()
 			case <-c.stopCh:
 				return nil
-			case <-time.NewTimer(b.NextBackOff()).C:
+			case <-time.NewTimer(d).C:
 				// Continue to the request.
 			}
 		}
-		shouldRetry, err := c.attemptRequest(client, req, ptrToReturnObj)
+		// Send whichever bearer token refreshBearerToken last adopted.
+		req.Header.Set("Authorization", "Bearer "+c.config.BearerToken)
+		shouldRetry, statusCode, err := attempt()
 		if !shouldRetry {
 			// The error may be nil or populated depending on whether the
 			// request was successful.
+			c.backoffs.reset(req)
 			return err
 		}
+		if c.config.Metrics != nil {
+			c.config.Metrics.RecordRetry(backoffKey(req), statusCode)
+		}
 		lastErr = err
 	}
-	return lastErr
+}
+
+// refreshBearerToken asks the config's tokenSource for a current token and,
+// if it differs from the one we last used, adopts it. It reports whether the
+// token changed, which tells the caller whether a retry is worth attempting.
+func (c *Client) refreshBearerToken() (refreshed bool, err error) {
+	if c.config.tokens == nil {
+		// This config authenticates some other way, e.g. a client
+		// certificate with no token to refresh.
+		return false, nil
+	}
+	token, err := c.config.tokens.Token()
+	if err != nil {
+		return false, err
+	}
+	if token == c.config.BearerToken {
+		return false, nil
+	}
+	c.config.BearerToken = token
+	return true, nil
 }
 
 // attemptRequest tries one single request. It's in its own function so each
 // response body can be closed before returning, which would read awkwardly if
 // executed in a loop.
-func (c *Client) attemptRequest(client *http.Client, req *http.Request, ptrToReturnObj interface{}) (shouldRetry bool, err error) {
+func (c *Client) attemptRequest(client *http.Client, req *http.Request, ptrToReturnObj interface{}) (shouldRetry bool, statusCode int, err error) {
+	breaker := c.circuits.forHost(req.URL.Host)
+	allowed, probe := breaker.allow()
+	if !allowed {
+		return false, 0, &ErrCircuitOpen{Host: req.URL.Host}
+	}
+
 	// Preserve the original request body so it can be viewed for debugging if needed.
 	// Reading it empties it, so we need to re-add it afterwards.
 	var reqBody []byte
@@ -167,7 +418,8 @@ func (c *Client) attemptRequest(client *http.Client, req *http.Request, ptrToRet
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return false, err
+		breaker.recordFailure(probe)
+		return false, 0, err
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
@@ -182,39 +434,133 @@ func (c *Client) attemptRequest(client *http.Client, req *http.Request, ptrToRet
 	// Check for success.
 	switch resp.StatusCode {
 	case 200, 201, 202, 204:
-		// Pass.
+		breaker.recordSuccess(probe)
 	case 401, 403:
-		// Perhaps the token from our bearer token file has been refreshed.
-		config, err := inClusterConfig()
+		// Perhaps our bearer token has been refreshed. Token rotation isn't
+		// an apiserver health signal, so it doesn't count toward the
+		// circuit breaker's failure budget either way.
+		refreshed, err := c.refreshBearerToken()
 		if err != nil {
-			return false, err
+			return false, resp.StatusCode, err
 		}
-		if config.BearerToken == c.config.BearerToken {
-			// It's the same token.
-			return false, fmt.Errorf("bad status code: %s", sanitizedDebuggingInfo(req, reqBody, resp))
+		if !refreshed {
+			return false, resp.StatusCode, fmt.Errorf("bad status code: %s", sanitizedDebuggingInfo(req, reqBody, resp))
 		}
-		c.config = config
 		// Continue to try again, but return the error too in case the caller would rather read it out.
-		return true, fmt.Errorf("bad status code: %s", sanitizedDebuggingInfo(req, reqBody, resp))
+		return true, resp.StatusCode, fmt.Errorf("bad status code: %s", sanitizedDebuggingInfo(req, reqBody, resp))
 	case 404:
-		return false, &ErrNotFound{debuggingInfo: sanitizedDebuggingInfo(req, reqBody, resp)}
+		return false, resp.StatusCode, &ErrNotFound{debuggingInfo: sanitizedDebuggingInfo(req, reqBody, resp)}
+	case 409:
+		// Another field manager owns a field this request is trying to set,
+		// most likely a Server-Side Apply conflict. This isn't transient, so
+		// we don't retry it -- the caller decides whether to retry with force.
+		return false, resp.StatusCode, parseFieldConflict(req, reqBody, resp)
 	case 500, 502, 503, 504:
 		// Could be transient.
-		return true, fmt.Errorf("unexpected status code: %s", sanitizedDebuggingInfo(req, reqBody, resp))
+		breaker.recordFailure(probe)
+		return true, resp.StatusCode, fmt.Errorf("unexpected status code: %s", sanitizedDebuggingInfo(req, reqBody, resp))
 	default:
 		// Unexpected.
-		return false, fmt.Errorf("unexpected status code: %s", sanitizedDebuggingInfo(req, reqBody, resp))
+		return false, resp.StatusCode, fmt.Errorf("unexpected status code: %s", sanitizedDebuggingInfo(req, reqBody, resp))
 	}
 
 	// We only arrive here with success.
 	// If we're not supposed to read out the body, we have nothing further
 	// to do here.
 	if ptrToReturnObj == nil {
-		return false, nil
+		return false, resp.StatusCode, nil
 	}
 
 	// Attempt to read out the body into the given return object.
-	return false, json.NewDecoder(resp.Body).Decode(ptrToReturnObj)
+	return false, resp.StatusCode, json.NewDecoder(resp.Body).Decode(ptrToReturnObj)
+}
+
+// attemptStreamRequest tries one single streaming request, such as the one
+// StreamLogs issues. Unlike attemptRequest, it doesn't buffer or close a
+// successful response's body -- it hands that back to the caller -- since
+// the whole point is to let the caller read it as it arrives.
+func (c *Client) attemptStreamRequest(client *http.Client, req *http.Request) (shouldRetry bool, statusCode int, body io.ReadCloser, err error) {
+	breaker := c.circuits.forHost(req.URL.Host)
+	allowed, probe := breaker.allow()
+	if !allowed {
+		return false, 0, nil, &ErrCircuitOpen{Host: req.URL.Host}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		breaker.recordFailure(probe)
+		return false, 0, nil, err
+	}
+
+	switch resp.StatusCode {
+	case 200:
+		breaker.recordSuccess(probe)
+		return false, resp.StatusCode, resp.Body, nil
+	case 401, 403:
+		defer resp.Body.Close()
+		// Perhaps our bearer token has been refreshed. Token rotation isn't
+		// an apiserver health signal, so it doesn't count toward the
+		// circuit breaker's failure budget either way.
+		refreshed, err := c.refreshBearerToken()
+		if err != nil {
+			return false, resp.StatusCode, nil, err
+		}
+		if !refreshed {
+			return false, resp.StatusCode, nil, fmt.Errorf("bad status code: %s", sanitizedDebuggingInfo(req, nil, resp))
+		}
+		// Continue to try again, but return the error too in case the caller would rather read it out.
+		return true, resp.StatusCode, nil, fmt.Errorf("bad status code: %s", sanitizedDebuggingInfo(req, nil, resp))
+	case 404:
+		defer resp.Body.Close()
+		return false, resp.StatusCode, nil, &ErrNotFound{debuggingInfo: sanitizedDebuggingInfo(req, nil, resp)}
+	case 500, 502, 503, 504:
+		defer resp.Body.Close()
+		// Could be transient.
+		breaker.recordFailure(probe)
+		return true, resp.StatusCode, nil, fmt.Errorf("unexpected status code: %s", sanitizedDebuggingInfo(req, nil, resp))
+	default:
+		defer resp.Body.Close()
+		return false, resp.StatusCode, nil, fmt.Errorf("unexpected status code: %s", sanitizedDebuggingInfo(req, nil, resp))
+	}
+}
+
+// logStream wraps the raw response body from StreamLogs so that it's safe to
+// Close concurrently with an in-flight Read, and so the stream tears itself
+// down if the client's stopCh closes while a Read is blocked on it (e.g.
+// during process shutdown, with follow=true).
+type logStream struct {
+	body io.ReadCloser
+
+	closeOnce sync.Once
+	closeErr  error
+	done      chan struct{}
+}
+
+func newLogStream(body io.ReadCloser, stopCh <-chan struct{}) *logStream {
+	s := &logStream{
+		body: body,
+		done: make(chan struct{}),
+	}
+	go func() {
+		select {
+		case <-stopCh:
+			s.Close()
+		case <-s.done:
+		}
+	}()
+	return s
+}
+
+func (s *logStream) Read(p []byte) (int, error) {
+	return s.body.Read(p)
+}
+
+func (s *logStream) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.closeErr = s.body.Close()
+	})
+	return s.closeErr
 }
 
 type Pod struct {
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestStreamLogs_QueryParametersAndBody(t *testing.T) {
+	var gotQuery url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.Query()
+		if got, want := r.URL.Path, "/api/v1/namespaces/default/pods/my-pod/log"; got != want {
+			t.Errorf("path = %q, want %q", got, want)
+		}
+		fmt.Fprintln(w, "line one")
+		fmt.Fprintln(w, "line two")
+	}))
+	defer srv.Close()
+
+	c := testClient(t, srv.URL)
+	since := int64(30)
+	tail := int64(100)
+	body, err := c.StreamLogs("default", "my-pod", LogParams{
+		Container:    "app",
+		Follow:       true,
+		SinceSeconds: &since,
+		TailLines:    &tail,
+	})
+	if err != nil {
+		t.Fatalf("StreamLogs returned error: %v", err)
+	}
+	defer body.Close()
+
+	if got := gotQuery.Get("container"); got != "app" {
+		t.Errorf("container = %q, want %q", got, "app")
+	}
+	if got := gotQuery.Get("follow"); got != "true" {
+		t.Errorf("follow = %q, want %q", got, "true")
+	}
+	if got := gotQuery.Get("sinceSeconds"); got != "30" {
+		t.Errorf("sinceSeconds = %q, want %q", got, "30")
+	}
+	if got := gotQuery.Get("tailLines"); got != "100" {
+		t.Errorf("tailLines = %q, want %q", got, "100")
+	}
+
+	scanner := bufio.NewScanner(body)
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	want := []string{"line one", "line two"}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d: %v", len(lines), len(want), lines)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d = %q, want %q", i, lines[i], want[i])
+		}
+	}
+}
+
+func TestStreamLogs_RequiresNamespaceAndPodName(t *testing.T) {
+	c := testClient(t, "https://apiserver")
+	if _, err := c.StreamLogs("", "my-pod", LogParams{}); err != ErrNamespaceUnset {
+		t.Errorf("got %v, want ErrNamespaceUnset", err)
+	}
+	if _, err := c.StreamLogs("default", "", LogParams{}); err != ErrPodNameUnset {
+		t.Errorf("got %v, want ErrPodNameUnset", err)
+	}
+}
+
+// blockingReadCloser simulates a live streaming response body: Read blocks
+// until the body is Closed, the way an *http.Response.Body does while a
+// server keeps the connection open.
+type blockingReadCloser struct {
+	unblock chan struct{}
+}
+
+func (b *blockingReadCloser) Read(p []byte) (int, error) {
+	<-b.unblock
+	return 0, io.ErrClosedPipe
+}
+
+func (b *blockingReadCloser) Close() error {
+	close(b.unblock)
+	return nil
+}
+
+func TestLogStream_StopChUnblocksInFlightRead(t *testing.T) {
+	body := &blockingReadCloser{unblock: make(chan struct{})}
+	stopCh := make(chan struct{})
+	s := newLogStream(body, stopCh)
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := s.Read(make([]byte, 16))
+		readErr <- err
+	}()
+
+	close(stopCh)
+
+	select {
+	case err := <-readErr:
+		if err == nil {
+			t.Fatal("Read returned nil error, want the error from the body closed by stopCh")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read did not unblock after stopCh closed")
+	}
+}
+
+func TestLogStream_CloseIsIdempotent(t *testing.T) {
+	body := &blockingReadCloser{unblock: make(chan struct{})}
+	s := newLogStream(body, make(chan struct{}))
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("first Close returned error: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("second Close returned error: %v", err)
+	}
+}
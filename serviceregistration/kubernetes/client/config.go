@@ -0,0 +1,367 @@
+package client
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	envVarKubernetesServiceHost = "KUBERNETES_SERVICE_HOST"
+	envVarKubernetesServicePort = "KUBERNETES_SERVICE_PORT"
+
+	svcAccountCACertPath = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	svcAccountTokenPath  = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
+// Config holds everything needed to talk to a Kubernetes apiserver,
+// regardless of whether it was discovered from the in-cluster service
+// account or loaded from a kubeconfig file.
+type Config struct {
+	Host       string
+	CACert     []byte
+	CACertPool *x509.CertPool
+
+	BearerToken string
+
+	// ClientCert and ClientKey, if set, are used for TLS client-certificate
+	// authentication, as kubeconfig "user" entries commonly configure.
+	ClientCert []byte
+	ClientKey  []byte
+
+	// ImpersonateUser and ImpersonateGroups, if set, are sent as
+	// Impersonate-User/Impersonate-Group headers on every request.
+	ImpersonateUser   string
+	ImpersonateGroups []string
+
+	// BackoffInitialInterval, BackoffMaxInterval, BackoffMaxElapsedTime, and
+	// BackoffMultiplier tune the retry backoff Client.do and
+	// Client.StreamLogs use. A zero value leaves the backoff library's own
+	// default for that parameter in place.
+	BackoffInitialInterval time.Duration
+	BackoffMaxInterval     time.Duration
+	BackoffMaxElapsedTime  time.Duration
+	BackoffMultiplier      float64
+
+	// Metrics, if set, is notified of retries and backoff delays, so they
+	// can be wired up to Prometheus or another metrics system externally.
+	Metrics MetricsRecorder
+
+	// CircuitBreakerFailureThreshold, CircuitBreakerWindow, and
+	// CircuitBreakerCooldown tune the per-host circuit breaker that
+	// protects the apiserver from retry storms. Zero values fall back to
+	// defaultCircuitBreakerFailureThreshold/Window/Cooldown.
+	CircuitBreakerFailureThreshold int
+	CircuitBreakerWindow           time.Duration
+	CircuitBreakerCooldown         time.Duration
+
+	// CircuitObserver, if set, is notified of circuit breaker state
+	// transitions per host.
+	CircuitObserver CircuitObserver
+
+	// tokens supplies a fresh BearerToken when one's needed, e.g. on a
+	// 401/403. It's nil for configs that authenticate solely by client
+	// certificate.
+	tokens tokenSource
+}
+
+// tokenSource supplies a bearer token that may need to be refreshed, such as
+// by re-reading the service account token file or invoking an exec
+// credential plugin named in a kubeconfig's "user" entry.
+type tokenSource interface {
+	Token() (string, error)
+}
+
+// fileTokenSource re-reads a bearer token from disk, the way the in-cluster
+// service account token is rotated underneath a running pod.
+type fileTokenSource struct {
+	path string
+}
+
+func (f *fileTokenSource) Token() (string, error) {
+	token, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return "", err
+	}
+	return string(token), nil
+}
+
+// staticTokenSource returns a fixed token, such as one read directly out of
+// a kubeconfig's "user.token" field. It never needs to be refreshed, but
+// implements tokenSource so callers don't need to special-case it.
+type staticTokenSource string
+
+func (s staticTokenSource) Token() (string, error) {
+	return string(s), nil
+}
+
+// execTokenSource obtains a bearer token by invoking an external credential
+// plugin, the "exec" mechanism kubectl and client-go use for plugins like
+// aws-iam-authenticator or gke-gcloud-auth-plugin.
+type execTokenSource struct {
+	command string
+	args    []string
+	env     []string
+}
+
+func (e *execTokenSource) Token() (string, error) {
+	cmd := exec.Command(e.command, e.args...)
+	cmd.Env = append(os.Environ(), e.env...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("exec credential plugin %q failed: %w", e.command, err)
+	}
+
+	var cred execCredential
+	if err := json.Unmarshal(stdout.Bytes(), &cred); err != nil {
+		return "", fmt.Errorf("exec credential plugin %q returned invalid output: %w", e.command, err)
+	}
+	if cred.Status.Token == "" {
+		return "", fmt.Errorf("exec credential plugin %q did not return a token", e.command)
+	}
+	return cred.Status.Token, nil
+}
+
+// execCredential is the minimal subset of the client.authentication.k8s.io
+// ExecCredential response we need.
+type execCredential struct {
+	Status struct {
+		Token string `json:"token"`
+	} `json:"status"`
+}
+
+// inClusterConfig builds a Config from the service account Kubernetes
+// mounts into every pod.
+func inClusterConfig() (*Config, error) {
+	host := os.Getenv(envVarKubernetesServiceHost)
+	port := os.Getenv(envVarKubernetesServicePort)
+	if host == "" || port == "" {
+		return nil, ErrNotInCluster
+	}
+
+	tokens := &fileTokenSource{path: svcAccountTokenPath}
+	token, err := tokens.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := ioutil.ReadFile(svcAccountCACertPath)
+	if err != nil {
+		return nil, err
+	}
+	certPool := x509.NewCertPool()
+	if ok := certPool.AppendCertsFromPEM(ca); !ok {
+		return nil, errors.New("unable to parse in-cluster CA certificate")
+	}
+
+	return &Config{
+		Host:        "https://" + net.JoinHostPort(host, port),
+		CACert:      ca,
+		CACertPool:  certPool,
+		BearerToken: token,
+		tokens:      tokens,
+	}, nil
+}
+
+// kubeConfig is the minimal subset of a kubeconfig file's schema needed to
+// build a Config from it.
+type kubeConfig struct {
+	Clusters       []kubeConfigNamedCluster `yaml:"clusters"`
+	Contexts       []kubeConfigNamedContext `yaml:"contexts"`
+	CurrentContext string                   `yaml:"current-context"`
+	Users          []kubeConfigNamedUser    `yaml:"users"`
+}
+
+type kubeConfigNamedCluster struct {
+	Name    string            `yaml:"name"`
+	Cluster kubeConfigCluster `yaml:"cluster"`
+}
+
+type kubeConfigCluster struct {
+	Server                   string `yaml:"server"`
+	CertificateAuthority     string `yaml:"certificate-authority"`
+	CertificateAuthorityData string `yaml:"certificate-authority-data"`
+}
+
+type kubeConfigNamedContext struct {
+	Name    string            `yaml:"name"`
+	Context kubeConfigContext `yaml:"context"`
+}
+
+type kubeConfigContext struct {
+	Cluster string `yaml:"cluster"`
+	User    string `yaml:"user"`
+}
+
+type kubeConfigNamedUser struct {
+	Name string         `yaml:"name"`
+	User kubeConfigUser `yaml:"user"`
+}
+
+type kubeConfigUser struct {
+	Token                 string              `yaml:"token"`
+	ClientCertificate     string              `yaml:"client-certificate"`
+	ClientCertificateData string              `yaml:"client-certificate-data"`
+	ClientKey             string              `yaml:"client-key"`
+	ClientKeyData         string              `yaml:"client-key-data"`
+	Impersonate           string              `yaml:"as"`
+	ImpersonateGroups     []string            `yaml:"as-groups"`
+	Exec                  *kubeConfigExecUser `yaml:"exec"`
+}
+
+type kubeConfigExecUser struct {
+	Command string                 `yaml:"command"`
+	Args    []string               `yaml:"args"`
+	Env     []kubeConfigExecEnvVar `yaml:"env"`
+}
+
+type kubeConfigExecEnvVar struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+func (kc *kubeConfig) context(name string) (kubeConfigContext, bool) {
+	for _, c := range kc.Contexts {
+		if c.Name == name {
+			return c.Context, true
+		}
+	}
+	return kubeConfigContext{}, false
+}
+
+func (kc *kubeConfig) cluster(name string) (kubeConfigCluster, bool) {
+	for _, c := range kc.Clusters {
+		if c.Name == name {
+			return c.Cluster, true
+		}
+	}
+	return kubeConfigCluster{}, false
+}
+
+func (kc *kubeConfig) user(name string) (kubeConfigUser, bool) {
+	for _, u := range kc.Users {
+		if u.Name == name {
+			return u.User, true
+		}
+	}
+	return kubeConfigUser{}, false
+}
+
+// configFromKubeconfig loads the kubeconfig file at path and builds a Config
+// from the named context, or from its "current-context" if contextName is
+// empty.
+func configFromKubeconfig(path string, contextName string) (*Config, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var kc kubeConfig
+	if err := yaml.Unmarshal(raw, &kc); err != nil {
+		return nil, fmt.Errorf("unable to parse kubeconfig %q: %w", path, err)
+	}
+
+	if contextName == "" {
+		contextName = kc.CurrentContext
+	}
+	if contextName == "" {
+		return nil, fmt.Errorf("kubeconfig %q has no current-context and none was given", path)
+	}
+
+	kcContext, ok := kc.context(contextName)
+	if !ok {
+		return nil, fmt.Errorf("kubeconfig %q has no context named %q", path, contextName)
+	}
+	cluster, ok := kc.cluster(kcContext.Cluster)
+	if !ok {
+		return nil, fmt.Errorf("kubeconfig %q has no cluster named %q", path, kcContext.Cluster)
+	}
+	user, ok := kc.user(kcContext.User)
+	if !ok {
+		return nil, fmt.Errorf("kubeconfig %q has no user named %q", path, kcContext.User)
+	}
+
+	baseDir := filepath.Dir(path)
+
+	ca, err := dataOrFile(cluster.CertificateAuthorityData, cluster.CertificateAuthority, baseDir)
+	if err != nil {
+		return nil, err
+	}
+	certPool := x509.NewCertPool()
+	if len(ca) > 0 && !certPool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("unable to parse CA certificate for cluster %q", kcContext.Cluster)
+	}
+
+	config := &Config{
+		Host:              cluster.Server,
+		CACert:            ca,
+		CACertPool:        certPool,
+		ImpersonateUser:   user.Impersonate,
+		ImpersonateGroups: user.ImpersonateGroups,
+	}
+
+	if user.ClientCertificateData != "" || user.ClientCertificate != "" {
+		cert, err := dataOrFile(user.ClientCertificateData, user.ClientCertificate, baseDir)
+		if err != nil {
+			return nil, err
+		}
+		key, err := dataOrFile(user.ClientKeyData, user.ClientKey, baseDir)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCert = cert
+		config.ClientKey = key
+	}
+
+	switch {
+	case user.Exec != nil:
+		var env []string
+		for _, e := range user.Exec.Env {
+			env = append(env, e.Name+"="+e.Value)
+		}
+		tokens := &execTokenSource{
+			command: user.Exec.Command,
+			args:    user.Exec.Args,
+			env:     env,
+		}
+		token, err := tokens.Token()
+		if err != nil {
+			return nil, err
+		}
+		config.BearerToken = token
+		config.tokens = tokens
+	case user.Token != "":
+		config.BearerToken = user.Token
+		config.tokens = staticTokenSource(user.Token)
+	}
+
+	return config, nil
+}
+
+// dataOrFile returns the base64-decoded contents of data if it's set, or
+// else reads path, resolved relative to baseDir if it's not already
+// absolute. This mirrors how a kubeconfig's "*-data" fields take precedence
+// over their file-path counterparts.
+func dataOrFile(data string, path string, baseDir string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if path == "" {
+		return nil, nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+	return ioutil.ReadFile(path)
+}
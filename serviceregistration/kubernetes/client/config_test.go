@@ -0,0 +1,186 @@
+package client
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// selfSignedCertPEM generates a throwaway self-signed certificate, just to
+// give dataOrFile/configFromKubeconfig something x509.CertPool will accept.
+func selfSignedCertPEM(t *testing.T) []byte {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test-ca"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestDataOrFile_DataTakesPrecedenceOverFile(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "ca.crt")
+	if err := os.WriteFile(filePath, []byte("from-file"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	data := base64.StdEncoding.EncodeToString([]byte("from-data"))
+	got, err := dataOrFile(data, "ca.crt", dir)
+	if err != nil {
+		t.Fatalf("dataOrFile returned error: %v", err)
+	}
+	if string(got) != "from-data" {
+		t.Fatalf("got %q, want %q", got, "from-data")
+	}
+}
+
+func TestDataOrFile_FallsBackToFileResolvedAgainstBaseDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ca.crt"), []byte("from-file"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := dataOrFile("", "ca.crt", dir)
+	if err != nil {
+		t.Fatalf("dataOrFile returned error: %v", err)
+	}
+	if string(got) != "from-file" {
+		t.Fatalf("got %q, want %q", got, "from-file")
+	}
+}
+
+func TestDataOrFile_NeitherSetReturnsNil(t *testing.T) {
+	got, err := dataOrFile("", "", t.TempDir())
+	if err != nil {
+		t.Fatalf("dataOrFile returned error: %v", err)
+	}
+	if got != nil {
+		t.Fatalf("got %q, want nil", got)
+	}
+}
+
+func writeKubeconfig(t *testing.T, dir string, caPEM []byte, currentContext string) string {
+	t.Helper()
+	caPath := filepath.Join(dir, "ca.crt")
+	if err := os.WriteFile(caPath, caPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	contents := `
+clusters:
+- name: prod
+  cluster:
+    server: https://prod.example.com
+    certificate-authority: ca.crt
+contexts:
+- name: prod-ctx
+  context:
+    cluster: prod
+    user: prod-user
+- name: other-ctx
+  context:
+    cluster: prod
+    user: other-user
+current-context: ` + currentContext + `
+users:
+- name: prod-user
+  user:
+    token: prod-token
+- name: other-user
+  user:
+    exec:
+      command: sh
+      args:
+      - -c
+      - echo '{"status":{"token":"exec-token"}}'
+`
+	path := filepath.Join(dir, "config")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigFromKubeconfig_UsesCurrentContext(t *testing.T) {
+	dir := t.TempDir()
+	path := writeKubeconfig(t, dir, selfSignedCertPEM(t), "prod-ctx")
+
+	config, err := configFromKubeconfig(path, "")
+	if err != nil {
+		t.Fatalf("configFromKubeconfig returned error: %v", err)
+	}
+	if config.Host != "https://prod.example.com" {
+		t.Errorf("Host = %q, want %q", config.Host, "https://prod.example.com")
+	}
+	if config.BearerToken != "prod-token" {
+		t.Errorf("BearerToken = %q, want %q", config.BearerToken, "prod-token")
+	}
+	if config.CACertPool == nil {
+		t.Error("CACertPool is nil, want a pool built from the kubeconfig's certificate-authority file")
+	}
+}
+
+func TestConfigFromKubeconfig_ExplicitContextOverridesCurrentContext(t *testing.T) {
+	dir := t.TempDir()
+	path := writeKubeconfig(t, dir, selfSignedCertPEM(t), "prod-ctx")
+
+	config, err := configFromKubeconfig(path, "other-ctx")
+	if err != nil {
+		t.Fatalf("configFromKubeconfig returned error: %v", err)
+	}
+	if config.BearerToken != "exec-token" {
+		t.Errorf("BearerToken = %q, want %q from the exec plugin", config.BearerToken, "exec-token")
+	}
+}
+
+func TestConfigFromKubeconfig_NoCurrentContextErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := writeKubeconfig(t, dir, selfSignedCertPEM(t), "")
+
+	if _, err := configFromKubeconfig(path, ""); err == nil {
+		t.Fatal("expected an error when the kubeconfig has no current-context and none was given")
+	}
+}
+
+func TestExecTokenSource_InvokesPluginAndParsesToken(t *testing.T) {
+	src := &execTokenSource{
+		command: "sh",
+		args:    []string{"-c", `echo '{"status":{"token":"plugin-token"}}'`},
+	}
+	token, err := src.Token()
+	if err != nil {
+		t.Fatalf("Token() returned error: %v", err)
+	}
+	if token != "plugin-token" {
+		t.Fatalf("Token() = %q, want %q", token, "plugin-token")
+	}
+}
+
+func TestExecTokenSource_MissingTokenErrors(t *testing.T) {
+	src := &execTokenSource{
+		command: "sh",
+		args:    []string{"-c", `echo '{"status":{}}'`},
+	}
+	if _, err := src.Token(); err == nil {
+		t.Fatal("expected an error when the plugin's response has no token")
+	}
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+)
+
+// PatchType selects which of the Kubernetes patch strategies a patch
+// request uses. Strategic merge patches are required for correctly
+// updating list-valued fields (e.g. a container's env) without replacing
+// the whole list; merge patches follow RFC 7396; JSON patches follow RFC
+// 6902, which is what PatchPod has always sent.
+type PatchType string
+
+const (
+	JSONPatch           PatchType = "application/json-patch+json"
+	MergePatch          PatchType = "application/merge-patch+json"
+	StrategicMergePatch PatchType = "application/strategic-merge-patch+json"
+)
+
+// Patch sends body to r as a patch of the given type.
+func (c *Client) Patch(r *Resource, patchType PatchType, body []byte) error {
+	return c.PatchContext(context.Background(), r, patchType, body)
+}
+
+// PatchContext is Patch, but the request is also abandoned if ctx is done.
+// r.Namespace may be left empty to patch a cluster-scoped resource.
+func (c *Client) PatchContext(ctx context.Context, r *Resource, patchType PatchType, body []byte) error {
+	if r.Name == "" {
+		return ErrNameUnset
+	}
+
+	req, err := http.NewRequest(http.MethodPatch, c.config.Host+r.endpoint(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", string(patchType))
+	return c.do(ctx, req, nil)
+}
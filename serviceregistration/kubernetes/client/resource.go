@@ -0,0 +1,287 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff"
+)
+
+// Resource identifies a Kubernetes object or collection by its REST
+// coordinates: kind, apiVersion, namespace, and name. Name is left empty
+// when the Resource refers to a collection, as with List and Watch.
+type Resource struct {
+	// APIVersion is the resource's apiVersion, such as "v1" or "apps/v1".
+	// Core resources (pods, services, configmaps, ...) use just the
+	// version; everything else is "<group>/<version>".
+	APIVersion string
+
+	// Kind is the resource's lowercase, plural REST name, e.g. "pods" or
+	// "deployments" -- the path segment the apiserver expects, not the
+	// capitalized Kind an object's TypeMeta carries.
+	Kind string
+
+	Namespace string
+	Name      string
+}
+
+// endpoint returns the REST path for r, e.g.
+// "/api/v1/namespaces/default/pods/my-pod" or
+// "/apis/apps/v1/namespaces/default/deployments".
+func (r *Resource) endpoint() string {
+	base := fmt.Sprintf("/api/%s", r.APIVersion)
+	if strings.Contains(r.APIVersion, "/") {
+		base = fmt.Sprintf("/apis/%s", r.APIVersion)
+	}
+	if r.Namespace != "" {
+		base = fmt.Sprintf("%s/namespaces/%s", base, r.Namespace)
+	}
+	base = fmt.Sprintf("%s/%s", base, r.Kind)
+	if r.Name != "" {
+		base = fmt.Sprintf("%s/%s", base, r.Name)
+	}
+	return base
+}
+
+// ListOptions narrows which objects List and Watch return.
+type ListOptions struct {
+	LabelSelector string
+	FieldSelector string
+
+	// ResourceVersion, if set, is passed through to the apiserver as-is.
+	// List uses it as a cache read consistency hint; Watch uses it as the
+	// point to start streaming changes from.
+	ResourceVersion string
+}
+
+// WatchOptions is ListOptions under another name, kept distinct so call
+// sites read naturally even though the fields Watch needs are identical.
+type WatchOptions = ListOptions
+
+// Get retrieves the single object identified by r into out.
+func (c *Client) Get(r *Resource, out interface{}) error {
+	return c.GetContext(context.Background(), r, out)
+}
+
+// GetContext is Get, but the request is also abandoned if ctx is done. r.Namespace
+// may be left empty for a cluster-scoped resource.
+func (c *Client) GetContext(ctx context.Context, r *Resource, out interface{}) error {
+	if r.Name == "" {
+		return ErrNameUnset
+	}
+	req, err := http.NewRequest(http.MethodGet, c.config.Host+r.endpoint(), nil)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, req, out)
+}
+
+// List retrieves the collection of objects matching opts into out, which
+// should be a pointer to a type shaped like the resource's Kubernetes List
+// kind.
+func (c *Client) List(r *Resource, opts ListOptions, out interface{}) error {
+	return c.ListContext(context.Background(), r, opts, out)
+}
+
+// ListContext is List, but the request is also abandoned if ctx is done. r.Namespace
+// may be left empty to list a cluster-scoped resource, or to list a
+// namespaced one across all namespaces.
+func (c *Client) ListContext(ctx context.Context, r *Resource, opts ListOptions, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, c.config.Host+r.endpoint()+"?"+listQuery(opts).Encode(), nil)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, req, out)
+}
+
+func listQuery(opts ListOptions) url.Values {
+	query := url.Values{}
+	if opts.LabelSelector != "" {
+		query.Set("labelSelector", opts.LabelSelector)
+	}
+	if opts.FieldSelector != "" {
+		query.Set("fieldSelector", opts.FieldSelector)
+	}
+	if opts.ResourceVersion != "" {
+		query.Set("resourceVersion", opts.ResourceVersion)
+	}
+	return query
+}
+
+// EventType is the kind of change a watch Event represents.
+type EventType string
+
+const (
+	Added    EventType = "ADDED"
+	Modified EventType = "MODIFIED"
+	Deleted  EventType = "DELETED"
+)
+
+// Event is one line of a Kubernetes watch stream: a change to a single
+// object. Object is left as raw JSON since its concrete type depends on
+// which Resource is being watched.
+type Event struct {
+	Type   EventType       `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// watchObjectMeta is the sliver of an object's metadata Watch needs in
+// order to resume a dropped connection from the last resourceVersion seen.
+type watchObjectMeta struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+}
+
+// Watch streams changes to objects matching r and opts. It resumes
+// automatically from the last observed resourceVersion if the connection
+// drops, and falls back to a full relist (starting again with no
+// resourceVersion) if the apiserver responds 410 Gone because that
+// version has aged out of its cache. The returned channel is closed once
+// ctx is done or the client's stopCh closes.
+func (c *Client) Watch(r *Resource, opts WatchOptions) (<-chan Event, error) {
+	return c.WatchContext(context.Background(), r, opts)
+}
+
+// WatchContext is Watch, but the stream is also torn down if ctx is done.
+// r.Namespace may be left empty to watch a cluster-scoped resource, or to
+// watch a namespaced one across all namespaces.
+func (c *Client) WatchContext(ctx context.Context, r *Resource, opts WatchOptions) (<-chan Event, error) {
+	events := make(chan Event)
+	go c.watchLoop(ctx, r, opts, events)
+	return events, nil
+}
+
+func (c *Client) watchLoop(ctx context.Context, r *Resource, opts WatchOptions, events chan<- Event) {
+	defer close(events)
+
+	// reconnectBackoff paces reconnect attempts that fail, or end, without
+	// ever delivering an event -- e.g. a watch against a host whose circuit
+	// breaker is open -- so watchOnce returning immediately doesn't spin
+	// this loop tight. It's reset whenever a connection actually delivers
+	// something, so a healthy watch that merely drops and resumes doesn't
+	// pay an escalating delay.
+	reconnectBackoff := c.newExponentialBackOff()
+
+	resourceVersion := opts.ResourceVersion
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.stopCh:
+			return
+		default:
+		}
+
+		relist, next, delivered, err := c.watchOnce(ctx, r, opts, resourceVersion, events)
+		if err != nil && c.logger.IsWarn() {
+			c.logger.Warn(fmt.Sprintf("watch of %s interrupted, reconnecting: %s", r.endpoint(), err))
+		}
+		if relist {
+			resourceVersion = ""
+		} else {
+			resourceVersion = next
+		}
+
+		if delivered {
+			reconnectBackoff.Reset()
+			continue
+		}
+
+		d := reconnectBackoff.NextBackOff()
+		if d == backoff.Stop {
+			reconnectBackoff.Reset()
+			d = reconnectBackoff.NextBackOff()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.stopCh:
+			return
+		case <-time.NewTimer(d).C:
+		}
+	}
+}
+
+// watchOnce opens a single watch connection and streams its frames into
+// events until the connection ends, reporting whether the apiserver asked
+// for a relist, the resourceVersion to resume from on the next attempt, and
+// whether at least one event was delivered before the connection ended.
+func (c *Client) watchOnce(ctx context.Context, r *Resource, opts WatchOptions, resourceVersion string, events chan<- Event) (relist bool, next string, delivered bool, err error) {
+	query := listQuery(opts)
+	query.Set("watch", "true")
+	if resourceVersion != "" {
+		query.Set("resourceVersion", resourceVersion)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, c.config.Host+r.endpoint()+"?"+query.Encode(), nil)
+	if err != nil {
+		return false, resourceVersion, false, err
+	}
+
+	body, statusCode, err := c.openWatchStream(ctx, req)
+	if statusCode == http.StatusGone {
+		return true, "", false, nil
+	}
+	if err != nil {
+		return false, resourceVersion, false, err
+	}
+	if body == nil {
+		// The client's stopCh closed while we were waiting to retry.
+		return false, resourceVersion, false, nil
+	}
+	defer body.Close()
+
+	dec := json.NewDecoder(body)
+	for {
+		var event Event
+		if err := dec.Decode(&event); err != nil {
+			if err == io.EOF {
+				return false, resourceVersion, delivered, nil
+			}
+			return false, resourceVersion, delivered, err
+		}
+
+		var meta watchObjectMeta
+		if err := json.Unmarshal(event.Object, &meta); err == nil && meta.Metadata.ResourceVersion != "" {
+			resourceVersion = meta.Metadata.ResourceVersion
+		}
+
+		select {
+		case events <- event:
+			delivered = true
+		case <-ctx.Done():
+			return false, resourceVersion, delivered, nil
+		case <-c.stopCh:
+			return false, resourceVersion, delivered, nil
+		}
+	}
+}
+
+// openWatchStream issues a single watch request and hands back its raw
+// response body, going through the same retry/backoff/token-refresh
+// plumbing as every other request but stopping short of decoding so watch
+// frames can be streamed out as they arrive.
+func (c *Client) openWatchStream(ctx context.Context, req *http.Request) (io.ReadCloser, int, error) {
+	req = req.WithContext(ctx)
+	client, err := c.prepareRequest(req)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var body io.ReadCloser
+	var statusCode int
+	err = c.retryLoop(ctx, req, func() (bool, int, error) {
+		shouldRetry, sc, b, err := c.attemptStreamRequest(client, req)
+		statusCode = sc
+		body = b
+		return shouldRetry, sc, err
+	})
+	return body, statusCode, err
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// testClient builds a Client pointed at an httptest server, with a stopCh
+// that's closed automatically when the test ends.
+func testClient(t *testing.T, host string) *Client {
+	t.Helper()
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	return newClient(hclog.NewNullLogger(), &Config{Host: host}, stopCh)
+}
+
+func TestWatchOnce_RelistOn410Gone(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer srv.Close()
+
+	c := testClient(t, srv.URL)
+	r := &Resource{APIVersion: "v1", Kind: "pods", Namespace: "default"}
+	events := make(chan Event)
+
+	relist, _, delivered, err := c.watchOnce(context.Background(), r, WatchOptions{}, "", events)
+	if err != nil {
+		t.Fatalf("watchOnce returned error: %v", err)
+	}
+	if !relist {
+		t.Fatal("relist = false, want true on 410 Gone")
+	}
+	if delivered {
+		t.Fatal("delivered = true, want false when no events were sent")
+	}
+}
+
+func TestWatchOnce_ResumesFromLastResourceVersion(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"type":"ADDED","object":{"metadata":{"resourceVersion":"10"}}}`)
+		fmt.Fprintln(w, `{"type":"MODIFIED","object":{"metadata":{"resourceVersion":"11"}}}`)
+	}))
+	defer srv.Close()
+
+	c := testClient(t, srv.URL)
+	r := &Resource{APIVersion: "v1", Kind: "pods", Namespace: "default"}
+	events := make(chan Event, 2)
+
+	relist, next, delivered, err := c.watchOnce(context.Background(), r, WatchOptions{}, "", events)
+	if err != nil {
+		t.Fatalf("watchOnce returned error: %v", err)
+	}
+	if relist {
+		t.Fatal("relist = true, want false for a clean disconnect")
+	}
+	if !delivered {
+		t.Fatal("delivered = false, want true")
+	}
+	if next != "11" {
+		t.Fatalf("next resourceVersion = %q, want %q", next, "11")
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d buffered events, want 2", len(events))
+	}
+}
+
+func TestWatchOnce_ResumesFromGivenResourceVersionOnDisconnect(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("resourceVersion"); got != "42" {
+			t.Errorf("request resourceVersion = %q, want %q", got, "42")
+		}
+	}))
+	defer srv.Close()
+
+	c := testClient(t, srv.URL)
+	r := &Resource{APIVersion: "v1", Kind: "pods", Namespace: "default"}
+	events := make(chan Event)
+
+	relist, next, delivered, err := c.watchOnce(context.Background(), r, WatchOptions{}, "42", events)
+	if err != nil {
+		t.Fatalf("watchOnce returned error: %v", err)
+	}
+	if relist {
+		t.Fatal("relist = true, want false")
+	}
+	if delivered {
+		t.Fatal("delivered = true, want false when the server sent no frames")
+	}
+	if next != "42" {
+		t.Fatalf("next resourceVersion = %q, want %q to be carried through unchanged", next, "42")
+	}
+}